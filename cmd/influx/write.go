@@ -6,12 +6,14 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	platform "github.com/influxdata/influxdb"
 	"github.com/influxdata/influxdb/http"
 	"github.com/influxdata/influxdb/kit/signals"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/write"
+	"github.com/influxdata/influxdb/write/csv"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -26,12 +28,35 @@ or add an entire file specified with an @ prefix.`,
 }
 
 var writeFlags struct {
-	BucketID  string
-	Bucket    string
-	Precision string
+	BucketID         string
+	Bucket           string
+	Precision        string
+	AutoCreateBucket bool
+	MaxRetries       int
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	Compression      string
+	BatchSize        int
+	MaxConcurrency   int
+
+	Format               string
+	CSVHeader            bool
+	CSVMeasurementColumn string
+	CSVTimestampColumn   string
+	CSVTimestampFormat   string
+	CSVTagColumns        []string
+	CSVFieldColumns      []string
+	CSVSkipRowOnError    bool
+
 	organization
 }
 
+// Supported values for --format.
+const (
+	formatLineProtocol = "lp"
+	formatCSV          = "csv"
+)
+
 func init() {
 	writeFlags.organization.register(writeCmd)
 
@@ -52,6 +77,29 @@ func init() {
 	if p := viper.GetString("PRECISION"); p != "" && writeFlags.Precision == "" {
 		writeFlags.Precision = p
 	}
+
+	viper.BindEnv("AUTO_CREATE_BUCKET")
+	writeCmd.PersistentFlags().BoolVar(&writeFlags.AutoCreateBucket, "auto-create-bucket", false, "Create the destination bucket if it does not already exist (ignored when --bucket-id is used)")
+	if viper.IsSet("AUTO_CREATE_BUCKET") {
+		writeFlags.AutoCreateBucket = viper.GetBool("AUTO_CREATE_BUCKET")
+	}
+
+	writeCmd.PersistentFlags().IntVar(&writeFlags.MaxRetries, "max-retries", write.DefaultMaxRetries, "Max number of retries on a batch when a transient error occurs; 0 disables retries")
+	writeCmd.PersistentFlags().DurationVar(&writeFlags.RetryInterval, "retry-interval", write.DefaultRetryInterval, "Initial retry delay; each retry doubles with jitter, up to --max-retry-interval")
+	writeCmd.PersistentFlags().DurationVar(&writeFlags.MaxRetryInterval, "max-retry-interval", write.DefaultMaxRetryInterval, "Cap on the backoff delay between retries, applied before +/-50% jitter")
+
+	writeCmd.PersistentFlags().StringVar(&writeFlags.Compression, "compression", string(write.CompressionGZIP), "Compression applied to each batch body: gzip|none")
+	writeCmd.PersistentFlags().IntVar(&writeFlags.BatchSize, "batch-size", write.DefaultBatchSize, "Number of lines sent per HTTP request")
+	writeCmd.PersistentFlags().IntVar(&writeFlags.MaxConcurrency, "max-concurrency", write.DefaultMaxConcurrency, "Number of batches that may be in flight at once")
+
+	writeCmd.PersistentFlags().StringVar(&writeFlags.Format, "format", formatLineProtocol, "Input format: lp|csv")
+	writeCmd.PersistentFlags().BoolVar(&writeFlags.CSVHeader, "csv-header", false, "The CSV input has a header row naming its columns (not required for annotated CSV)")
+	writeCmd.PersistentFlags().StringVar(&writeFlags.CSVMeasurementColumn, "csv-measurement-column", "", "Name of the CSV column holding the measurement")
+	writeCmd.PersistentFlags().StringVar(&writeFlags.CSVTimestampColumn, "csv-timestamp-column", "", "Name of the CSV column holding the timestamp")
+	writeCmd.PersistentFlags().StringVar(&writeFlags.CSVTimestampFormat, "csv-timestamp-format", "", "Layout used to parse --csv-timestamp-column, e.g. RFC3339 (defaults to RFC3339Nano)")
+	writeCmd.PersistentFlags().StringSliceVar(&writeFlags.CSVTagColumns, "csv-tag-columns", nil, "Names of CSV columns to write as tags")
+	writeCmd.PersistentFlags().StringSliceVar(&writeFlags.CSVFieldColumns, "csv-field-columns", nil, "Names of CSV columns to write as fields")
+	writeCmd.PersistentFlags().BoolVar(&writeFlags.CSVSkipRowOnError, "skip-row-on-error", false, "Log and skip malformed CSV rows instead of aborting the write")
 }
 
 func fluxWriteF(cmd *cobra.Command, args []string) error {
@@ -72,6 +120,17 @@ func fluxWriteF(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalid precision")
 	}
 
+	compression := write.CompressionType(writeFlags.Compression)
+	if compression != write.CompressionGZIP && compression != write.CompressionNone {
+		cmd.Usage()
+		return fmt.Errorf("invalid compression type %q", writeFlags.Compression)
+	}
+
+	if writeFlags.Format != formatLineProtocol && writeFlags.Format != formatCSV {
+		cmd.Usage()
+		return fmt.Errorf("invalid format %q", writeFlags.Format)
+	}
+
 	httpClient, err := newHTTPClient()
 	if err != nil {
 		return err
@@ -107,17 +166,30 @@ func fluxWriteF(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to retrieve buckets: %v", err)
 	}
 
+	var bucketID, orgID platform.ID
 	if n == 0 {
-		if writeFlags.Bucket != "" {
+		if writeFlags.BucketID != "" {
+			return fmt.Errorf("bucket with id %q does not exist", writeFlags.BucketID)
+		}
+
+		if writeFlags.Bucket == "" {
 			return fmt.Errorf("bucket %q was not found", writeFlags.Bucket)
 		}
 
-		if writeFlags.BucketID != "" {
-			return fmt.Errorf("bucket with id %q does not exist", writeFlags.BucketID)
+		// --bucket-id can't be auto-created since IDs are minted server-side.
+		if !writeFlags.AutoCreateBucket {
+			return fmt.Errorf("bucket %q was not found", writeFlags.Bucket)
+		}
+
+		bucket, err := createBucket(ctx, httpClient, writeFlags.organization, writeFlags.Bucket)
+		if err != nil {
+			return err
 		}
-	}
 
-	bucketID, orgID := buckets[0].ID, buckets[0].OrgID
+		bucketID, orgID = bucket.ID, bucket.OrgID
+	} else {
+		bucketID, orgID = buckets[0].ID, buckets[0].OrgID
+	}
 
 	var r io.Reader
 	if args[0] == "-" {
@@ -133,13 +205,37 @@ func fluxWriteF(cmd *cobra.Command, args []string) error {
 		r = strings.NewReader(args[0])
 	}
 
-	s := write.Batcher{
-		Service: &http.WriteService{
+	if writeFlags.Format == formatCSV {
+		r = csv.NewLineProtocolReader(r, csv.Config{
+			Header:            writeFlags.CSVHeader,
+			MeasurementColumn: writeFlags.CSVMeasurementColumn,
+			TimestampColumn:   writeFlags.CSVTimestampColumn,
+			TimestampFormat:   writeFlags.CSVTimestampFormat,
+			Precision:         writeFlags.Precision,
+			TagColumns:        writeFlags.CSVTagColumns,
+			FieldColumns:      writeFlags.CSVFieldColumns,
+			SkipRowOnError:    writeFlags.CSVSkipRowOnError,
+		})
+	}
+
+	retrying := &write.RetryingService{
+		WriteService: &http.WriteService{
 			Addr:               flags.host,
 			Token:              flags.token,
 			Precision:          writeFlags.Precision,
 			InsecureSkipVerify: flags.skipVerify,
+			GZIP:               compression == write.CompressionGZIP,
 		},
+		MaxRetries:       writeFlags.MaxRetries,
+		RetryInterval:    writeFlags.RetryInterval,
+		MaxRetryInterval: writeFlags.MaxRetryInterval,
+	}
+
+	s := write.Batcher{
+		Service:        retrying,
+		Compression:    compression,
+		BatchSize:      writeFlags.BatchSize,
+		MaxConcurrency: writeFlags.MaxConcurrency,
 	}
 
 	ctx = signals.WithStandardSignals(ctx)
@@ -149,3 +245,39 @@ func fluxWriteF(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// createBucket resolves org's ID and creates a bucket named name within it
+// with an infinite retention period, returning the newly created bucket.
+func createBucket(ctx context.Context, httpClient *http.Client, org organization, name string) (*platform.Bucket, error) {
+	var orgID platform.ID
+	if org.id != "" {
+		id, err := platform.IDFromString(org.id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode org id: %v", err)
+		}
+		orgID = *id
+	} else {
+		orgSvc := &http.OrganizationService{Client: httpClient}
+		o, err := orgSvc.FindOrganization(ctx, platform.OrganizationFilter{Name: &org.name})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve organization %q: %v", org.name, err)
+		}
+		orgID = o.ID
+	}
+
+	bucket := &platform.Bucket{
+		OrgID:           orgID,
+		Name:            name,
+		RetentionPeriod: 0, // infinite retention
+	}
+
+	bs := &http.BucketService{Client: httpClient}
+	if err := bs.CreateBucket(ctx, bucket); err != nil {
+		if platform.ErrorCode(err) == platform.EUnauthorized {
+			return nil, fmt.Errorf("not authorized to create bucket %q: %v", name, err)
+		}
+		return nil, fmt.Errorf("failed to create bucket %q: %v", name, err)
+	}
+
+	return bucket, nil
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	platform "github.com/influxdata/influxdb"
+)
+
+// WriteService writes a single batch of line protocol to an InfluxDB
+// server over HTTP. It implements platform.WriteService.
+type WriteService struct {
+	Addr               string
+	Token              string
+	Precision          string
+	InsecureSkipVerify bool
+
+	// GZIP indicates that r, as passed to Write, is already gzip-compressed
+	// and that the request should be sent with a Content-Encoding: gzip
+	// header so the server decodes it before parsing. Defaults to false.
+	GZIP bool
+}
+
+// Write sends r, the body of a single write batch, to the server's
+// /api/v2/write endpoint for orgID and bucketID.
+func (s *WriteService) Write(ctx context.Context, orgID, bucketID platform.ID, r io.Reader) error {
+	u, err := url.Parse(s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to parse host address: %v", err)
+	}
+	u.Path = "/api/v2/write"
+
+	params := u.Query()
+	params.Set("org", orgID.String())
+	params.Set("bucket", bucketID.String())
+	if s.Precision != "" {
+		params.Set("precision", s.Precision)
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest("POST", u.String(), r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Authorization", "Token "+s.Token)
+	if s.GZIP {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify},
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return newWriteError(resp)
+	}
+
+	return nil
+}
+
+// writeError wraps a non-2xx response from the write endpoint. It carries
+// enough detail for write.RetryingService to decide whether to retry and
+// for the caller to surface the server's message.
+type writeError struct {
+	statusCode    int
+	retryAfter    time.Duration
+	hasRetryAfter bool
+	body          string
+}
+
+func newWriteError(resp *http.Response) error {
+	we := &writeError{statusCode: resp.StatusCode}
+
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := time.ParseDuration(ra + "s"); err == nil {
+			we.retryAfter, we.hasRetryAfter = secs, true
+		}
+	}
+
+	if mt, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && mt == "application/json" {
+		var e platform.Error
+		if err := json.NewDecoder(resp.Body).Decode(&e); err == nil {
+			we.body = e.Error()
+			return we
+		}
+	}
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	we.body = string(b)
+	return we
+}
+
+func (e *writeError) Error() string {
+	return fmt.Sprintf("server returned status %d: %s", e.statusCode, e.body)
+}
+
+// RetryAfter implements the interface write.RetryingService uses to honor
+// a server-specified Retry-After delay.
+func (e *writeError) RetryAfter() (time.Duration, bool) {
+	return e.retryAfter, e.hasRetryAfter
+}
+
+// Code reports the platform.ErrorCode for this failure so callers, such as
+// write.RetryingService, can classify it without inspecting status codes.
+func (e *writeError) Code() string {
+	switch e.statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return platform.EUnauthorized
+	case http.StatusTooManyRequests:
+		return platform.ETooManyRequests
+	case http.StatusServiceUnavailable:
+		return platform.EUnavailable
+	default:
+		if e.statusCode >= 500 {
+			return platform.EInternal
+		}
+		return platform.EInvalid
+	}
+}
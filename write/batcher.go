@@ -0,0 +1,177 @@
+package write
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"sync"
+
+	platform "github.com/influxdata/influxdb"
+)
+
+// Default tuning parameters for Batcher.
+const (
+	DefaultBatchSize      = 5000
+	DefaultMaxConcurrency = 4
+
+	maxScanTokenSize = 1024 * 1024
+)
+
+// CompressionType selects how batches are encoded before being handed to
+// Service.
+type CompressionType string
+
+// Supported CompressionType values.
+const (
+	CompressionGZIP CompressionType = "gzip"
+	CompressionNone CompressionType = "none"
+)
+
+// Batcher splits an input stream of line protocol into batches of lines and
+// writes them to Service, fanning batches out across a bounded pool of
+// workers so large file ingest doesn't serialize on the network.
+type Batcher struct {
+	Service platform.WriteService
+
+	// BatchSize is the number of lines sent per HTTP request. <= 0 uses
+	// DefaultBatchSize.
+	BatchSize int
+
+	// MaxConcurrency is the number of batches that may be in flight at
+	// once. <= 0 uses DefaultMaxConcurrency.
+	MaxConcurrency int
+
+	// Compression selects how each batch is encoded before being passed
+	// to Service. The empty value behaves like CompressionGZIP.
+	Compression CompressionType
+}
+
+// Write reads line protocol from r, splitting it into batches and writing
+// them to b.Service, in parallel up to b.MaxConcurrency. It returns the
+// first error encountered, after draining any batches already in flight.
+// ctx cancellation, or a worker error, stops new batches from being
+// dispatched.
+func (b Batcher) Write(ctx context.Context, orgID, bucketID platform.ID, r io.Reader) error {
+	batchSize := b.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	maxConcurrency := b.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = DefaultMaxConcurrency
+	}
+
+	// cctx is canceled as soon as a worker errors, so dispatch stops
+	// sending new batches while the ones already in flight are drained.
+	// It must not be consulted after wg.Wait(): a worker error cancels it
+	// too, so only ctx tells whether the caller canceled.
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxScanTokenSize)
+
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, maxConcurrency)
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	setErr := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	dispatch := func(lines []string) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if cctx.Err() != nil {
+				return
+			}
+
+			body, err := b.encode(lines)
+			if err != nil {
+				setErr(err)
+				return
+			}
+
+			if err := b.Service.Write(cctx, orgID, bucketID, body); err != nil {
+				setErr(err)
+			}
+		}()
+	}
+
+	batch := make([]string, 0, batchSize)
+	for scanner.Scan() {
+		if cctx.Err() != nil {
+			break
+		}
+
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		batch = append(batch, line)
+		if len(batch) >= batchSize {
+			dispatch(batch)
+			batch = make([]string, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 && cctx.Err() == nil {
+		dispatch(batch)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// gzipWriterPool reuses gzip.Writer values across batches to avoid
+// allocating a new compressor per request.
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// encode joins lines into a newline-delimited body and, unless compression
+// is disabled, gzip-compresses it.
+func (b Batcher) encode(lines []string) (io.Reader, error) {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	if b.Compression == CompressionNone {
+		return &buf, nil
+	}
+
+	gz := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(gz)
+
+	var out bytes.Buffer
+	gz.Reset(&out)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
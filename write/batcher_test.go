@@ -0,0 +1,119 @@
+package write
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	platform "github.com/influxdata/influxdb"
+)
+
+// recordingWriteService records the body of every Write call, optionally
+// failing the call numbered errAt (1-indexed).
+type recordingWriteService struct {
+	mu    sync.Mutex
+	calls [][]byte
+
+	n     int32
+	errAt int32
+	err   error
+}
+
+func (s *recordingWriteService) Write(ctx context.Context, orgID, bucketID platform.ID, r io.Reader) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, body)
+	s.mu.Unlock()
+
+	if n := atomic.AddInt32(&s.n, 1); s.errAt != 0 && n == s.errAt {
+		return s.err
+	}
+	return nil
+}
+
+func (s *recordingWriteService) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.calls)
+}
+
+func TestBatcher_SplitsAtBatchSize(t *testing.T) {
+	svc := &recordingWriteService{}
+	b := Batcher{Service: svc, BatchSize: 2, MaxConcurrency: 1, Compression: CompressionNone}
+
+	input := "m f=1i 1\nm f=2i 2\nm f=3i 3\n"
+	if err := b.Write(context.Background(), platform.ID(1), platform.ID(2), strings.NewReader(input)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if len(svc.calls) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(svc.calls))
+	}
+	if string(svc.calls[0]) != "m f=1i 1\nm f=2i 2\n" {
+		t.Fatalf("unexpected first batch: %q", svc.calls[0])
+	}
+	if string(svc.calls[1]) != "m f=3i 3\n" {
+		t.Fatalf("unexpected second batch: %q", svc.calls[1])
+	}
+}
+
+func TestBatcher_GZIPRoundTrip(t *testing.T) {
+	svc := &recordingWriteService{}
+	b := Batcher{Service: svc, BatchSize: 10, MaxConcurrency: 1, Compression: CompressionGZIP}
+
+	const line = "m f=1i 1\n"
+	if err := b.Write(context.Background(), platform.ID(1), platform.ID(2), strings.NewReader(line)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := svc.callCount(); n != 1 {
+		t.Fatalf("expected 1 batch, got %d", n)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(svc.calls[0]))
+	if err != nil {
+		t.Fatalf("batch body is not gzip-compressed: %v", err)
+	}
+	out, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("failed to decompress batch body: %v", err)
+	}
+	if string(out) != line {
+		t.Fatalf("got %q, want %q", out, line)
+	}
+}
+
+func TestBatcher_DrainsAndReturnsFirstErrorOnWorkerFailure(t *testing.T) {
+	wantErr := fmt.Errorf("boom")
+	svc := &recordingWriteService{errAt: 1, err: wantErr}
+	b := Batcher{Service: svc, BatchSize: 1, MaxConcurrency: 1, Compression: CompressionNone}
+
+	const numLines = 20
+	var lines []string
+	for i := 0; i < numLines; i++ {
+		lines = append(lines, fmt.Sprintf("m f=%di %d", i, i))
+	}
+	input := strings.Join(lines, "\n") + "\n"
+
+	err := b.Write(context.Background(), platform.ID(1), platform.ID(2), strings.NewReader(input))
+	if err != wantErr {
+		t.Fatalf("got error %v, want %v", err, wantErr)
+	}
+
+	if n := svc.callCount(); n >= numLines {
+		t.Fatalf("expected dispatch to stop once the first batch failed, but all %d batches were sent", n)
+	}
+}
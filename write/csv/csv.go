@@ -0,0 +1,406 @@
+// Package csv converts CSV and Flux "annotated CSV" input into line
+// protocol, so it can be fed into write.Batcher.
+package csv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flux annotated-CSV column datatypes. See
+// https://docs.influxdata.com/influxdb/latest/reference/syntax/annotated-csv/
+// Flux never emits a "tag" datatype: on annotated input, tags are instead
+// identified by the #group row (see column.group and isTagColumn).
+const (
+	datatypeDouble   = "double"
+	datatypeLong     = "long"
+	datatypeString   = "string"
+	datatypeBoolean  = "boolean"
+	datatypeDateTime = "dateTime"
+
+	// datatypeTag is not a real annotated-CSV datatype. datatypeFor uses
+	// it to mark a column named in Config.TagColumns when inferring
+	// column roles for plain, non-annotated header CSV.
+	datatypeTag = "tag"
+
+	// datatypeSkip marks a column, inferred from Config rather than a
+	// #datatype annotation, that isn't listed as a tag or field column
+	// and should be dropped from the output.
+	datatypeSkip = "skip"
+)
+
+// Config controls how CSV rows read by NewLineProtocolReader are
+// converted into line protocol.
+type Config struct {
+	// Header indicates the CSV carries a row naming its columns. It may
+	// be omitted if the input is annotated CSV, whose annotation rows are
+	// always followed by a row naming the columns.
+	Header bool
+
+	MeasurementColumn string
+	TimestampColumn   string
+
+	// TimestampFormat parses TimestampColumn. Defaults to
+	// time.RFC3339Nano. Ignored for columns annotated dateTime:<layout>.
+	TimestampFormat string
+
+	// Precision controls the magnitude of the emitted timestamp (ns, us,
+	// ms, or s, matching the --precision flag). Defaults to ns.
+	Precision string
+
+	TagColumns   []string
+	FieldColumns []string
+
+	// SkipRowOnError logs a malformed row, with its line number, and
+	// continues instead of failing the whole stream.
+	SkipRowOnError bool
+}
+
+// fluxMetadataColumns are columns Flux's annotated CSV always emits for
+// bookkeeping rather than as point data, and which NewLineProtocolReader
+// drops rather than writing as bogus fields. Only consulted on annotated
+// input: plain header CSV may legitimately name a tag or field column
+// "result" or "table".
+var fluxMetadataColumns = map[string]bool{
+	"result": true,
+	"table":  true,
+}
+
+// column describes how a single CSV column maps onto a line protocol
+// measurement, tag, field, or timestamp.
+type column struct {
+	name     string
+	datatype string // one of the datatype* constants
+	format   string // dateTime layout, e.g. RFC3339
+	group    bool   // true if the #group row marked this column part of the group key
+}
+
+// NewLineProtocolReader returns an io.Reader that streams line protocol
+// converted from the CSV read from r, as described by cfg. It never
+// buffers the whole input: rows are transformed as they are consumed
+// downstream, one at a time.
+func NewLineProtocolReader(r io.Reader, cfg Config) io.Reader {
+	pr, pw := io.Pipe()
+
+	t := &transformer{
+		cr:  csv.NewReader(r),
+		cfg: cfg,
+	}
+
+	go func() {
+		pw.CloseWithError(t.run(pw))
+	}()
+
+	return pr
+}
+
+type transformer struct {
+	cr  *csv.Reader
+	cfg Config
+
+	line      int
+	columns   []column
+	annotated bool // an annotation row was seen, so a names row always follows
+	named     bool // the names row has been consumed
+}
+
+func (t *transformer) run(w io.Writer) error {
+	t.cr.FieldsPerRecord = -1
+
+	for {
+		record, err := t.cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("csv: line %d: %v", t.line+1, err)
+		}
+		t.line++
+
+		if len(record) > 0 && strings.HasPrefix(record[0], "#") {
+			if err := t.readAnnotation(record); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !t.named {
+			if err := t.readNames(record); err != nil {
+				return err
+			}
+			continue
+		}
+
+		lp, err := t.toLineProtocol(record)
+		if err != nil {
+			if t.cfg.SkipRowOnError {
+				log.Printf("csv: skipping line %d: %v", t.line, err)
+				continue
+			}
+			return err
+		}
+
+		if _, err := io.WriteString(w, lp); err != nil {
+			return err
+		}
+	}
+}
+
+// readAnnotation consumes a single #datatype, #group, or #default row.
+func (t *transformer) readAnnotation(record []string) error {
+	switch strings.TrimPrefix(record[0], "#") {
+	case "datatype":
+		t.annotated = true
+		t.columns = make([]column, len(record))
+		for i, v := range record[1:] {
+			dt, format := v, ""
+			if idx := strings.IndexByte(v, ':'); idx >= 0 {
+				dt, format = v[:idx], v[idx+1:]
+			}
+			t.columns[i+1] = column{datatype: dt, format: format}
+		}
+		// Flux emits a fresh #datatype/#group/#default block, separated
+		// by a blank line, per table; a new one means a new names row
+		// follows before the next data row.
+		t.named = false
+	case "group":
+		for i, v := range record[1:] {
+			if i+1 < len(t.columns) {
+				t.columns[i+1].group = v == "true"
+			}
+		}
+	case "default":
+		// Default values don't affect the line protocol produced for
+		// subsequent rows; read and discard.
+	default:
+		return fmt.Errorf("csv: line %d: unrecognized annotation %q", t.line, record[0])
+	}
+	return nil
+}
+
+// readNames consumes the row naming each column, building t.columns if no
+// #datatype annotation already sized it.
+func (t *transformer) readNames(record []string) error {
+	if t.columns == nil {
+		if !t.cfg.Header {
+			return fmt.Errorf("csv: line %d: no header row or #datatype annotation seen before data", t.line)
+		}
+		t.columns = make([]column, len(record))
+		for i, name := range record {
+			t.columns[i] = column{datatype: t.datatypeFor(name)}
+		}
+	}
+
+	for i, name := range record {
+		if i < len(t.columns) {
+			t.columns[i].name = name
+		}
+	}
+	t.named = true
+	return nil
+}
+
+// datatypeFor infers a column's datatype from Config when no #datatype
+// annotation is present.
+func (t *transformer) datatypeFor(name string) string {
+	switch {
+	case name == t.cfg.MeasurementColumn, name == t.cfg.TimestampColumn:
+		return datatypeString
+	case contains(t.cfg.TagColumns, name):
+		return datatypeTag
+	case contains(t.cfg.FieldColumns, name):
+		return datatypeDouble
+	case len(t.cfg.FieldColumns) > 0:
+		return datatypeSkip
+	default:
+		return datatypeDouble
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// timestampColumn is the name of the column holding each row's timestamp.
+// Config.TimestampColumn wins if set; otherwise, on annotated input, "_time"
+// is assumed, since Flux always names its time column that.
+func (t *transformer) timestampColumn() string {
+	if t.cfg.TimestampColumn != "" {
+		return t.cfg.TimestampColumn
+	}
+	if t.annotated {
+		return "_time"
+	}
+	return ""
+}
+
+// isTagColumn reports whether col should be written as a tag. On
+// non-annotated input this is whatever Config.TagColumns named; on
+// annotated input it's any non-timestamp group-key column, matching
+// Flux's own convention that #group,true marks tags (and the
+// measurement, which is handled separately before this is consulted).
+func (t *transformer) isTagColumn(col column) bool {
+	if col.datatype == datatypeTag {
+		return true
+	}
+	return t.annotated && col.group
+}
+
+// toLineProtocol converts a single data row into one line of line
+// protocol, terminated with a newline.
+func (t *transformer) toLineProtocol(record []string) (string, error) {
+	var measurement, timestamp string
+	var tags, fields []string
+
+	for i, raw := range record {
+		if i >= len(t.columns) {
+			break
+		}
+		col := t.columns[i]
+
+		switch {
+		case col.datatype == datatypeSkip || (t.annotated && fluxMetadataColumns[col.name]):
+			continue
+		case col.name == t.cfg.MeasurementColumn:
+			measurement = escapeMeasurement(raw)
+		case col.name == t.timestampColumn():
+			ts, err := t.parseTimestamp(raw, col)
+			if err != nil {
+				return "", fmt.Errorf("csv: line %d: column %q: %v", t.line, col.name, err)
+			}
+			timestamp = ts
+		case col.datatype == datatypeDateTime:
+			// A dateTime column that isn't the chosen timestamp, e.g.
+			// Flux's _start/_stop table boundaries, carries no
+			// information for the point being written.
+			continue
+		case t.isTagColumn(col):
+			if raw == "" {
+				continue
+			}
+			tags = append(tags, fmt.Sprintf("%s=%s", escapeTag(col.name), escapeTag(raw)))
+		default:
+			if raw == "" {
+				continue
+			}
+			field, err := formatField(raw, col.datatype)
+			if err != nil {
+				return "", fmt.Errorf("csv: line %d: column %q: %v", t.line, col.name, err)
+			}
+			fields = append(fields, fmt.Sprintf("%s=%s", escapeTag(col.name), field))
+		}
+	}
+
+	if measurement == "" {
+		return "", fmt.Errorf("csv: line %d: empty measurement", t.line)
+	}
+	if len(fields) == 0 {
+		return "", fmt.Errorf("csv: line %d: no fields", t.line)
+	}
+
+	lp := measurement
+	for _, tag := range tags {
+		lp += "," + tag
+	}
+	lp += " " + strings.Join(fields, ",")
+	if timestamp != "" {
+		lp += " " + timestamp
+	}
+	return lp + "\n", nil
+}
+
+func (t *transformer) parseTimestamp(raw string, col column) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	layout := t.cfg.TimestampFormat
+	if col.format != "" {
+		layout = col.format
+	}
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	layout = namedTimestampLayout(layout)
+
+	ts, err := time.Parse(layout, raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid timestamp %q: %v", raw, err)
+	}
+	return strconv.FormatInt(ts.UnixNano()/precisionDivisor(t.cfg.Precision), 10), nil
+}
+
+// precisionDivisor returns the number of nanoseconds in one unit of
+// precision, matching the --precision flag values (ns, us, ms, s).
+func precisionDivisor(precision string) int64 {
+	switch precision {
+	case "us":
+		return int64(time.Microsecond)
+	case "ms":
+		return int64(time.Millisecond)
+	case "s":
+		return int64(time.Second)
+	default: // "ns" and unrecognized values
+		return 1
+	}
+}
+
+// namedTimestampLayout resolves the well-known layout names used by
+// annotated CSV (e.g. "RFC3339", "RFC3339Nano") to their Go time.Parse
+// layout strings. Anything else is assumed to already be a layout, as
+// supplied via --csv-timestamp-format.
+func namedTimestampLayout(name string) string {
+	switch name {
+	case "RFC3339":
+		return time.RFC3339
+	case "RFC3339Nano":
+		return time.RFC3339Nano
+	default:
+		return name
+	}
+}
+
+func formatField(raw, datatype string) (string, error) {
+	switch datatype {
+	case datatypeLong:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid long %q: %v", raw, err)
+		}
+		return strconv.FormatInt(v, 10) + "i", nil
+	case datatypeBoolean:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid boolean %q: %v", raw, err)
+		}
+		return strconv.FormatBool(v), nil
+	case datatypeString:
+		return strconv.Quote(raw), nil
+	default: // datatypeDouble and anything unrecognized
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid double %q: %v", raw, err)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+}
+
+func escapeMeasurement(s string) string {
+	r := strings.NewReplacer(",", "\\,", " ", "\\ ")
+	return r.Replace(s)
+}
+
+func escapeTag(s string) string {
+	r := strings.NewReplacer(",", "\\,", " ", "\\ ", "=", "\\=")
+	return r.Replace(s)
+}
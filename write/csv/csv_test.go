@@ -0,0 +1,183 @@
+package csv
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNewLineProtocolReader_AnnotatedCSV(t *testing.T) {
+	// A realistic example of what `influx query ... | pivot(...) | to csv`
+	// actually emits: result/table are bookkeeping, _start/_stop are the
+	// query's window boundaries (not the point's own time), and host is a
+	// tag only because #group marks it part of the group key.
+	input := `#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,string,string,double
+#group,false,false,true,true,false,true,true,false
+#default,_result,,,,,,,
+,result,table,_start,_stop,_time,_measurement,host,value
+,_result,0,2020-01-01T00:00:00Z,2020-01-01T01:00:00Z,2020-01-01T00:00:30Z,cpu,server01,1.5
+`
+
+	r := NewLineProtocolReader(strings.NewReader(input), Config{
+		MeasurementColumn: "_measurement",
+		TimestampColumn:   "_time",
+	})
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "cpu,host=server01 value=1.5 1577836830000000000\n"
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestNewLineProtocolReader_AnnotatedCSVDefaultTimestampColumn(t *testing.T) {
+	// When --csv-timestamp-column is left unset, annotated input's _time
+	// column is still used as the timestamp.
+	input := `#datatype,string,dateTime:RFC3339,double
+#group,true,false,false
+#default,cpu,,
+,_measurement,_time,value
+,cpu,2020-01-01T00:00:30Z,1.5
+`
+
+	r := NewLineProtocolReader(strings.NewReader(input), Config{
+		MeasurementColumn: "_measurement",
+	})
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "cpu value=1.5 1577836830000000000\n"
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestNewLineProtocolReader_HeaderCSVFieldNamedLikeFluxMetadata(t *testing.T) {
+	// fluxMetadataColumns only applies to annotated input: a plain CSV's
+	// own column named "table" is real data, not Flux bookkeeping.
+	input := "measurement,table,value\ncpu,7,1.5\n"
+
+	r := NewLineProtocolReader(strings.NewReader(input), Config{
+		Header:            true,
+		MeasurementColumn: "measurement",
+		FieldColumns:      []string{"table", "value"},
+	})
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "cpu table=7,value=1.5\n"
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestNewLineProtocolReader_AnnotatedCSVPrecision(t *testing.T) {
+	input := `#datatype,string,dateTime:RFC3339,double
+#group,true,false,false
+#default,cpu,,
+,_measurement,_time,value
+,cpu,2020-01-01T00:00:30Z,1.5
+`
+
+	r := NewLineProtocolReader(strings.NewReader(input), Config{
+		MeasurementColumn: "_measurement",
+		TimestampColumn:   "_time",
+		Precision:         "s",
+	})
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "cpu value=1.5 1577836830\n"
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestNewLineProtocolReader_AnnotatedCSVMultiTable(t *testing.T) {
+	// Flux emits one #datatype/#group/#default/names block per table,
+	// separated by a blank line; the second table's names row must not be
+	// mistaken for data.
+	input := `#datatype,string,dateTime:RFC3339,double
+#group,true,false,false
+#default,cpu,,
+,_measurement,_time,value
+,cpu,2020-01-01T00:00:00Z,1.5
+
+#datatype,string,dateTime:RFC3339,double
+#group,true,false,false
+#default,mem,,
+,_measurement,_time,value
+,mem,2020-01-01T00:01:00Z,2.5
+`
+
+	r := NewLineProtocolReader(strings.NewReader(input), Config{
+		MeasurementColumn: "_measurement",
+		TimestampColumn:   "_time",
+	})
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "cpu value=1.5 1577836800000000000\nmem value=2.5 1577836860000000000\n"
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestNewLineProtocolReader_HeaderCSV(t *testing.T) {
+	input := "measurement,host,value\ncpu,server01,42\n"
+
+	r := NewLineProtocolReader(strings.NewReader(input), Config{
+		Header:            true,
+		MeasurementColumn: "measurement",
+		TagColumns:        []string{"host"},
+		FieldColumns:      []string{"value"},
+	})
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "cpu,host=server01 value=42\n"
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestNewLineProtocolReader_SkipRowOnError(t *testing.T) {
+	input := "measurement,host,value\ncpu,server01,not-a-number\ncpu,server02,2\n"
+
+	r := NewLineProtocolReader(strings.NewReader(input), Config{
+		Header:            true,
+		MeasurementColumn: "measurement",
+		TagColumns:        []string{"host"},
+		FieldColumns:      []string{"value"},
+		SkipRowOnError:    true,
+	})
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "cpu,host=server02 value=2\n"
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,158 @@
+package write
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+
+	platform "github.com/influxdata/influxdb"
+)
+
+// Default tuning parameters for RetryingService.
+const (
+	DefaultMaxRetries       = 5
+	DefaultRetryInterval    = time.Second
+	DefaultMaxRetryInterval = 30 * time.Second
+)
+
+// RetryingService wraps a platform.WriteService, retrying writes that fail
+// with a transient error using capped exponential backoff with jitter.
+type RetryingService struct {
+	platform.WriteService
+
+	// MaxRetries is the number of attempts made after the initial write
+	// fails. A negative value uses DefaultMaxRetries; 0 disables retries
+	// entirely.
+	MaxRetries int
+
+	// RetryInterval is the initial delay before the first retry. A
+	// negative value uses DefaultRetryInterval; 0 retries immediately.
+	RetryInterval time.Duration
+
+	// MaxRetryInterval caps the exponential backoff delay before jitter is
+	// applied, so a retry may wait up to 1.5 times this value, or longer if
+	// the server's Retry-After asks for more. A negative value uses
+	// DefaultMaxRetryInterval; 0 caps the backoff delay to zero.
+	MaxRetryInterval time.Duration
+}
+
+// NewRetryingService returns a RetryingService wrapping s with the default
+// retry tuning parameters.
+func NewRetryingService(s platform.WriteService) *RetryingService {
+	return &RetryingService{
+		WriteService:     s,
+		MaxRetries:       DefaultMaxRetries,
+		RetryInterval:    DefaultRetryInterval,
+		MaxRetryInterval: DefaultMaxRetryInterval,
+	}
+}
+
+// retryAfterer is implemented by errors that carry a server-provided
+// Retry-After delay, such as an HTTP 429 response.
+type retryAfterer interface {
+	RetryAfter() (time.Duration, bool)
+}
+
+// Write buffers r and attempts to write it, retrying with capped
+// exponential backoff and jitter on transient errors. The attempt counter
+// is reset on every call, so a fresh backoff sequence begins for each batch.
+func (s *RetryingService) Write(ctx context.Context, orgID, bucketID platform.ID, r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	maxRetries := s.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	interval := s.RetryInterval
+	if interval < 0 {
+		interval = DefaultRetryInterval
+	}
+	maxInterval := s.MaxRetryInterval
+	if maxInterval < 0 {
+		maxInterval = DefaultMaxRetryInterval
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		lastErr = s.WriteService.Write(ctx, orgID, bucketID, bytes.NewReader(buf))
+		if lastErr == nil {
+			return nil
+		}
+
+		if attempt == maxRetries || !isRetryable(lastErr) {
+			return lastErr
+		}
+
+		wait := backoff(attempt, interval, maxInterval)
+		if d, ok := retryAfter(lastErr); ok && d > wait {
+			wait = d
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return lastErr
+}
+
+// backoff computes base * 2^attempt, capped at max, with +/-50% jitter.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := float64(base) * math.Pow(2, float64(attempt))
+	if d > float64(max) {
+		d = float64(max)
+	}
+	jitter := 0.5 + rand.Float64()
+	return time.Duration(d * jitter)
+}
+
+// isRetryable reports whether err represents a transient failure worth
+// retrying: a network error that reports itself temporary or a timeout, or
+// a 429/5xx response from the server.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if netErr, ok := err.(net.Error); ok {
+		return netErr.Temporary() || netErr.Timeout()
+	}
+
+	// platform.ErrorCode treats every error that isn't a *platform.Error as
+	// EInternal, so errors carrying their own Code(), such as the HTTP
+	// write service's, are asked directly, and uncoded errors fail fast.
+	var code string
+	switch e := err.(type) {
+	case interface{ Code() string }:
+		code = e.Code()
+	case *platform.Error:
+		code = platform.ErrorCode(e)
+	default:
+		return false
+	}
+
+	switch code {
+	case platform.ETooManyRequests, platform.EInternal, platform.EUnavailable:
+		return true
+	}
+
+	return false
+}
+
+// retryAfter extracts a Retry-After delay from err, if present.
+func retryAfter(err error) (time.Duration, bool) {
+	if ra, ok := err.(retryAfterer); ok {
+		return ra.RetryAfter()
+	}
+	return 0, false
+}
@@ -0,0 +1,114 @@
+package write
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	platform "github.com/influxdata/influxdb"
+)
+
+// fakeWriteService fails the first failures calls then succeeds, recording
+// the body seen on each call.
+type fakeWriteService struct {
+	failures int
+	err      error
+
+	calls  int
+	bodies [][]byte
+}
+
+func (f *fakeWriteService) Write(ctx context.Context, orgID, bucketID platform.ID, r io.Reader) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.bodies = append(f.bodies, body)
+	f.calls++
+
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+type tempError struct{ temporary bool }
+
+func (e tempError) Error() string   { return "temporary error" }
+func (e tempError) Temporary() bool { return e.temporary }
+func (e tempError) Timeout() bool   { return false }
+
+func TestRetryingService_SucceedsAfterTransientFailures(t *testing.T) {
+	fake := &fakeWriteService{failures: 2, err: tempError{temporary: true}}
+	s := &RetryingService{
+		WriteService:     fake,
+		MaxRetries:       5,
+		RetryInterval:    time.Millisecond,
+		MaxRetryInterval: 2 * time.Millisecond,
+	}
+
+	const body = "m,t=v f=1i 1\n"
+	if err := s.Write(context.Background(), platform.ID(1), platform.ID(2), strings.NewReader(body)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fake.calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", fake.calls)
+	}
+	for _, b := range fake.bodies {
+		if string(b) != body {
+			t.Fatalf("expected body %q on every attempt, got %q", body, b)
+		}
+	}
+}
+
+func TestRetryingService_GivesUpAfterMaxRetries(t *testing.T) {
+	fake := &fakeWriteService{failures: 10, err: tempError{temporary: true}}
+	s := &RetryingService{
+		WriteService:     fake,
+		MaxRetries:       2,
+		RetryInterval:    time.Millisecond,
+		MaxRetryInterval: 2 * time.Millisecond,
+	}
+
+	if err := s.Write(context.Background(), platform.ID(1), platform.ID(2), strings.NewReader("m f=1i 1\n")); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if fake.calls != 3 { // initial attempt + 2 retries
+		t.Fatalf("expected 3 calls, got %d", fake.calls)
+	}
+}
+
+func TestRetryingService_MaxRetriesZeroDisablesRetries(t *testing.T) {
+	fake := &fakeWriteService{failures: 10, err: tempError{temporary: true}}
+	s := &RetryingService{
+		WriteService: fake,
+		MaxRetries:   0,
+	}
+
+	if err := s.Write(context.Background(), platform.ID(1), platform.ID(2), strings.NewReader("m f=1i 1\n")); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if fake.calls != 1 {
+		t.Fatalf("explicit MaxRetries: 0 should make a single attempt, got %d calls", fake.calls)
+	}
+}
+
+func TestRetryingService_FailsFastOnNonRetryableError(t *testing.T) {
+	fake := &fakeWriteService{failures: 10, err: errors.New("bad request")}
+	s := NewRetryingService(fake)
+
+	if err := s.Write(context.Background(), platform.ID(1), platform.ID(2), strings.NewReader("m f=1i 1\n")); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if fake.calls != 1 {
+		t.Fatalf("expected 1 call, got %d", fake.calls)
+	}
+}